@@ -1,33 +1,65 @@
 package main
 
+import (
+	"context"
+	"sync/atomic"
+)
+
+const (
+	unlocked uint32 = 0
+	locked   uint32 = 1
+)
+
+// MatLock is a simple mutual-exclusion lock whose blocking slow path is a
+// channel rather than a futex/semaphore syscall.
 type MatLock struct {
-	locked bool
-	wait chan struct{}
+	state uint32
+	wait  chan struct{}
 }
 
 func NewQutex() *MatLock {
 	return &MatLock{
-        locked: false,
-        wait:   make(chan struct{}, 1),
+		state: unlocked,
+		wait:  make(chan struct{}, 1),
+	}
+}
+
+// TryLock attempts to acquire the lock without blocking. It returns true if
+// the lock was acquired, false if it was already held. TryLock is O(1) and
+// never sleeps.
+func (q *MatLock) TryLock() bool {
+	return atomic.CompareAndSwapUint32(&q.state, unlocked, locked)
+}
+
+// TryLockContext blocks until the lock is acquired or ctx is cancelled or
+// deadlined, in which case it returns ctx.Err().
+func (q *MatLock) TryLockContext(ctx context.Context) error {
+	for {
+		if q.TryLock() {
+			return nil
+		}
+		select {
+		case <-q.wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
 func (q *MatLock) Lock() {
 	for {
-     	if !q.locked {
-          	q.locked = true
-          	return
-     	}
+		if q.TryLock() {
+			return
+		}
 		<-q.wait
 	}
 }
 
 func (q *MatLock) Unlock() {
-	if !q.locked {
+	if !atomic.CompareAndSwapUint32(&q.state, locked, unlocked) {
 		panic("unlock of unlocked qutex")
 	}
-	q.locked = false
-    
+
 	select {
 	case q.wait <- struct{}{}:
 	default:
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// matLockMapEntry is a reference-counted MatLock. refs is the number of
+// goroutines that have looked the entry up and not yet released it.
+type matLockMapEntry struct {
+	lock *MatLock
+	refs int32
+}
+
+// MatLockMap hands out per-key MatLock instances without requiring callers
+// to pre-allocate one per resource. Entries are created lazily on first
+// use and removed once their ref count drops to zero, so long-running
+// processes with high key cardinality (per-file, per-user, per-URL
+// locking) don't leak memory for keys that are no longer active.
+//
+// The map itself is guarded by a plain mutex rather than sync.Map: ref
+// counting and entry deletion must happen as one atomic step, or a
+// concurrent acquirer can increment the ref count of an entry that is
+// already being deleted and end up holding a MatLock no one else can see.
+type MatLockMap struct {
+	mu      sync.Mutex
+	entries map[string]*matLockMapEntry
+}
+
+func NewMatLockMap() *MatLockMap {
+	return &MatLockMap{entries: make(map[string]*matLockMapEntry)}
+}
+
+func (m *MatLockMap) acquire(key string) *matLockMapEntry {
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	if !ok {
+		e = &matLockMapEntry{lock: NewQutex()}
+		m.entries[key] = e
+	}
+	e.refs++
+	m.mu.Unlock()
+	return e
+}
+
+func (m *MatLockMap) release(key string, e *matLockMapEntry) {
+	m.mu.Lock()
+	e.refs--
+	if e.refs == 0 {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+}
+
+// Lock blocks until the lock for key is acquired and returns a function
+// that unlocks and releases it. The caller must call the returned
+// function exactly once.
+func (m *MatLockMap) Lock(key string) func() {
+	e := m.acquire(key)
+	e.lock.Lock()
+	return func() {
+		e.lock.Unlock()
+		m.release(key, e)
+	}
+}
+
+// TryLock attempts to acquire the lock for key without blocking.
+func (m *MatLockMap) TryLock(key string) (unlock func(), ok bool) {
+	e := m.acquire(key)
+	if !e.lock.TryLock() {
+		m.release(key, e)
+		return nil, false
+	}
+	return func() {
+		e.lock.Unlock()
+		m.release(key, e)
+	}, true
+}
+
+// LockContext blocks until the lock for key is acquired or ctx is
+// cancelled or deadlined.
+func (m *MatLockMap) LockContext(ctx context.Context, key string) (unlock func(), err error) {
+	e := m.acquire(key)
+	if err := e.lock.TryLockContext(ctx); err != nil {
+		m.release(key, e)
+		return nil, err
+	}
+	return func() {
+		e.lock.Unlock()
+		m.release(key, e)
+	}, nil
+}
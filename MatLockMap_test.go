@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatLockMapBalancedUse(t *testing.T) {
+	m := NewMatLockMap()
+
+	unlock := m.Lock("a")
+	if len(m.entries) != 1 {
+		t.Fatalf("entries = %d, want 1 while key is held", len(m.entries))
+	}
+	unlock()
+	if len(m.entries) != 0 {
+		t.Fatalf("entries = %d, want 0 once the last holder released", len(m.entries))
+	}
+
+	unlock, ok := m.TryLock("b")
+	if !ok {
+		t.Fatal("TryLock failed on an unheld key")
+	}
+	if _, ok := m.TryLock("b"); ok {
+		t.Fatal("TryLock succeeded on a key already held")
+	}
+	unlock()
+	if len(m.entries) != 0 {
+		t.Fatalf("entries = %d, want 0 after TryLock's unlock", len(m.entries))
+	}
+}
+
+func TestMatLockMapLockContextCancellation(t *testing.T) {
+	m := NewMatLockMap()
+
+	unlock := m.Lock("k")
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := m.LockContext(ctx, "k")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("LockContext error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestMatLockMapConcurrentKeys exercises many goroutines hammering a small
+// set of keys, asserting that per-key mutual exclusion holds and that the
+// entries map is empty once every holder has released.
+func TestMatLockMapConcurrentKeys(t *testing.T) {
+	const (
+		keys       = 8
+		goroutines = 50
+		iterations = 200
+	)
+
+	m := NewMatLockMap()
+	counters := make(map[string]*int32)
+	for i := 0; i < keys; i++ {
+		var n int32
+		counters[keyFor(i)] = &n
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := keyFor((g + i) % keys)
+				unlock := m.Lock(key)
+				n := counters[key]
+				*n++
+				if *n != 1 {
+					t.Errorf("key %q held concurrently: counter = %d", key, *n)
+				}
+				*n--
+				unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	left := len(m.entries)
+	m.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("entries = %d, want 0 after all holders released", left)
+	}
+}
+
+func keyFor(i int) string {
+	return string(rune('a' + i))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatLockConcurrentIncrement(t *testing.T) {
+	const (
+		goroutines = 200
+		iterations = 1000
+	)
+
+	q := NewQutex()
+	counter := 0
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				q.Lock()
+				counter++
+				q.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := goroutines * iterations; counter != want {
+		t.Fatalf("counter = %d, want %d", counter, want)
+	}
+}
+
+func TestMatLockTryLock(t *testing.T) {
+	q := NewQutex()
+
+	if !q.TryLock() {
+		t.Fatal("TryLock failed on an unlocked MatLock")
+	}
+	if q.TryLock() {
+		t.Fatal("TryLock succeeded on an already-locked MatLock")
+	}
+	q.Unlock()
+
+	if !q.TryLock() {
+		t.Fatal("TryLock failed after Unlock")
+	}
+}
+
+func TestMatLockTryLockContextDeadlineExceeded(t *testing.T) {
+	q := NewQutex()
+	q.Lock()
+	defer q.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := q.TryLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("TryLockContext error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMatLockTryLockContextCancelled(t *testing.T) {
+	q := NewQutex()
+	q.Lock()
+	defer q.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := q.TryLockContext(ctx); err != context.Canceled {
+		t.Fatalf("TryLockContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestMatLockTryLockContextSucceedsOnceUnlocked(t *testing.T) {
+	q := NewQutex()
+	q.Lock()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := q.TryLockContext(ctx); err != nil {
+		t.Fatalf("TryLockContext error = %v, want nil", err)
+	}
+	q.Unlock()
+}
@@ -0,0 +1,169 @@
+package main
+
+import "sync/atomic"
+
+// MatRWLock is a writer-preferring reader/writer lock. It is modelled on
+// sync.RWMutex but keeps MatLock's channel-based blocking style instead of
+// a runtime-integrated semaphore.
+//
+// Once a writer calls Lock, new readers block until that writer has
+// acquired and released the lock, even if readers were already waiting;
+// this favours writers over a steady stream of readers. RLock/RUnlock
+// calls must be balanced, and the same goroutine must not hold both a
+// read and a write lock at once.
+type MatRWLock struct {
+	readers       int32
+	writerPending int32
+	wstate        uint32
+	rwait         chan struct{} // wakes readers blocked in RLock
+	wstateWait    chan struct{} // wakes writers blocked taking wstate in Lock
+	drainWait     chan struct{} // wakes the writer holding wstate, waiting for readers to drain
+}
+
+func NewMatRWLock() *MatRWLock {
+	return &MatRWLock{
+		rwait:      make(chan struct{}, 1),
+		wstateWait: make(chan struct{}, 1),
+		drainWait:  make(chan struct{}, 1),
+	}
+}
+
+// tryRLockOnce makes a single non-blocking attempt to take a read lock.
+func (l *MatRWLock) tryRLockOnce() bool {
+	if atomic.LoadInt32(&l.writerPending) != 0 {
+		return false
+	}
+	atomic.AddInt32(&l.readers, 1)
+	if atomic.LoadInt32(&l.writerPending) != 0 {
+		// A writer announced itself while we were registering as a
+		// reader; back out. This can bring readers to zero just like
+		// RUnlock does, so a writer parked in Lock's drain loop must
+		// be woken the same way - otherwise it waits on a drain event
+		// that already happened and never hears about it again.
+		l.releaseReader()
+		return false
+	}
+	return true
+}
+
+// TryRLock attempts to take a read lock without blocking.
+func (l *MatRWLock) TryRLock() bool {
+	return l.tryRLockOnce()
+}
+
+// RLock blocks while a writer holds or is waiting for the lock, then
+// registers as an active reader.
+func (l *MatRWLock) RLock() {
+	for {
+		if l.tryRLockOnce() {
+			return
+		}
+		<-l.rwait
+		// Relay the wakeup so any other reader blocked behind us also
+		// gets a chance to recheck, since rwait only wakes one waiter.
+		select {
+		case l.rwait <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// RUnlock releases a read lock taken with RLock or TryRLock.
+func (l *MatRWLock) RUnlock() {
+	if l.releaseReader() < 0 {
+		panic("RUnlock of unlocked MatRWLock")
+	}
+}
+
+// releaseReader decrements the reader count, waking a writer waiting in
+// Lock's drain loop if the count just dropped to zero, and returns the
+// new count.
+func (l *MatRWLock) releaseReader() int32 {
+	n := atomic.AddInt32(&l.readers, -1)
+	if n == 0 {
+		select {
+		case l.drainWait <- struct{}{}:
+		default:
+		}
+	}
+	return n
+}
+
+// afterTryLockWstateCAS runs immediately after TryLock wins the wstate
+// CAS, before it re-checks readers. It is a no-op in production; tests
+// use it to deterministically inject a reader arriving in that otherwise
+// unreproducible few-instruction window.
+var afterTryLockWstateCAS = func() {}
+
+// TryLock attempts to take the write lock without blocking.
+func (l *MatRWLock) TryLock() bool {
+	if atomic.LoadInt32(&l.readers) != 0 {
+		return false
+	}
+	if !atomic.CompareAndSwapUint32(&l.wstate, 0, 1) {
+		return false
+	}
+	atomic.AddInt32(&l.writerPending, 1)
+	afterTryLockWstateCAS()
+	if atomic.LoadInt32(&l.readers) != 0 {
+		atomic.AddInt32(&l.writerPending, -1)
+		atomic.StoreUint32(&l.wstate, 0)
+		l.wakeWstateWaiter()
+		// Readers that saw writerPending during this attempt are parked
+		// on rwait; wake them as Unlock does.
+		select {
+		case l.rwait <- struct{}{}:
+		default:
+		}
+		return false
+	}
+	return true
+}
+
+// Lock blocks until the write lock is acquired. It announces intent to
+// write immediately so that new readers stop arriving, then waits for
+// wstate to be free, then waits for the currently active readers to
+// drain. Each wait has its own channel (wstateWait, drainWait) so that a
+// wakeup meant for one waiting writer's wstate-CAS loop can never be
+// stolen by a different writer's readers-drain loop, or vice versa.
+func (l *MatRWLock) Lock() {
+	atomic.AddInt32(&l.writerPending, 1)
+
+	for !atomic.CompareAndSwapUint32(&l.wstate, 0, 1) {
+		<-l.wstateWait
+		// Relay in case another writer is also waiting on wstate.
+		select {
+		case l.wstateWait <- struct{}{}:
+		default:
+		}
+	}
+
+	for atomic.LoadInt32(&l.readers) != 0 {
+		<-l.drainWait
+	}
+}
+
+// Unlock releases the write lock taken with Lock or TryLock.
+func (l *MatRWLock) Unlock() {
+	if !atomic.CompareAndSwapUint32(&l.wstate, 1, 0) {
+		panic("Unlock of unlocked MatRWLock")
+	}
+	atomic.AddInt32(&l.writerPending, -1)
+	l.wakeWstateWaiter()
+
+	select {
+	case l.rwait <- struct{}{}:
+	default:
+	}
+}
+
+// wakeWstateWaiter wakes a writer waiting in Lock's wstate-CAS loop. It
+// must be called by every path that clears wstate - Unlock and TryLock's
+// rollback alike - or a writer already parked on wstateWait because it
+// lost the CAS race can be left waiting on a wakeup that never arrives.
+func (l *MatRWLock) wakeWstateWaiter() {
+	select {
+	case l.wstateWait <- struct{}{}:
+	default:
+	}
+}
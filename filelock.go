@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// MatFileLock provides Lock/Unlock/TryLock/LockContext - MatLock's
+// Lock/Unlock/TryLock/TryLockContext, each also returning an error -
+// backed by an OS advisory file lock so that multiple
+// *processes* - not just goroutines - can coordinate around a shared
+// resource, e.g. a file on disk.
+//
+// Calls are also serialized within this process, across every MatFileLock
+// value for the same path, via fileLockInproc. This matters because POSIX
+// advisory locks are associated with the (process, inode) pair, not the
+// file descriptor: two MatFileLock values for the same path - as WithLock
+// creates on every call - would otherwise each open their own fd, and the
+// OS would grant both an "exclusive" lock at once, since as far as it's
+// concerned this process already holds it.
+type MatFileLock struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	release func()
+}
+
+// fileLockInproc keys the in-process side of MatFileLock's locking by
+// path, so that any number of MatFileLock values created for the same
+// path - not just goroutines sharing one value - serialize with each
+// other before ever touching the OS lock.
+var fileLockInproc = NewMatLockMap()
+
+// NewFileLock returns a MatFileLock for path. The backing file is created
+// lazily on the first call to Lock, TryLock, or LockContext.
+func NewFileLock(path string) *MatFileLock {
+	return &MatFileLock{path: path}
+}
+
+func (f *MatFileLock) ensureOpen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	return nil
+}
+
+// Lock blocks until the file lock is acquired, across both goroutines in
+// this process and other processes locking the same path.
+func (f *MatFileLock) Lock() error {
+	release := fileLockInproc.Lock(f.path)
+	if err := f.ensureOpen(); err != nil {
+		release()
+		return err
+	}
+	if err := lockFile(f.file, true); err != nil {
+		release()
+		return err
+	}
+	f.setRelease(release)
+	return nil
+}
+
+// Unlock releases a lock taken with Lock, TryLock, or LockContext. It
+// panics if called without a prior successful Lock, TryLock, or
+// LockContext, just as MatLock.Unlock panics on an unlocked MatLock.
+func (f *MatFileLock) Unlock() error {
+	f.mu.Lock()
+	release := f.release
+	f.release = nil
+	f.mu.Unlock()
+	if release == nil {
+		panic("unlock of unlocked MatFileLock")
+	}
+	defer release()
+	return unlockFile(f.file)
+}
+
+// setRelease records the in-process release func for a successful lock,
+// guarded by f.mu since it's read back by a concurrent Unlock.
+func (f *MatFileLock) setRelease(release func()) {
+	f.mu.Lock()
+	f.release = release
+	f.mu.Unlock()
+}
+
+// TryLock attempts to acquire the lock without blocking. It returns false,
+// nil if the lock is already held, either in this process or another one.
+func (f *MatFileLock) TryLock() (bool, error) {
+	release, ok := fileLockInproc.TryLock(f.path)
+	if !ok {
+		return false, nil
+	}
+	if err := f.ensureOpen(); err != nil {
+		release()
+		return false, err
+	}
+	ok, err := tryLockFile(f.file)
+	if err != nil || !ok {
+		release()
+		return false, err
+	}
+	f.setRelease(release)
+	return true, nil
+}
+
+// filelockPollInterval is how often LockContext retries the OS file lock
+// while waiting on another process. fcntl/LockFileEx have no channel to
+// block on across processes the way MatLock's in-process wait chan does,
+// so cross-process cancellation has to be implemented by polling.
+const filelockPollInterval = 10 * time.Millisecond
+
+// LockContext blocks until the lock is acquired or ctx is cancelled or
+// deadlined, in which case it returns ctx.Err().
+func (f *MatFileLock) LockContext(ctx context.Context) error {
+	release, err := fileLockInproc.LockContext(ctx, f.path)
+	if err != nil {
+		return err
+	}
+	if err := f.ensureOpen(); err != nil {
+		release()
+		return err
+	}
+	for {
+		ok, err := tryLockFile(f.file)
+		if err != nil {
+			release()
+			return err
+		}
+		if ok {
+			f.setRelease(release)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			release()
+			return ctx.Err()
+		case <-time.After(filelockPollInterval):
+		}
+	}
+}
+
+// WithLock acquires the file lock at path, runs fn, and releases the lock,
+// matching the common lockedfile usage pattern.
+func WithLock(path string, fn func() error) error {
+	l := NewFileLock(path)
+	if err := l.Lock(); err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return fn()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const filelockChildEnv = "MATLOCK_FILELOCK_CHILD"
+
+// TestFileLockCrossProcess holds the lock in the parent test process, then
+// re-execs itself as a child with MATLOCK_FILELOCK_CHILD set; the child
+// verifies that it cannot also acquire the lock.
+func TestFileLockCrossProcess(t *testing.T) {
+	if os.Getenv(filelockChildEnv) != "" {
+		runFileLockChild()
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "lockfile")
+
+	l := NewFileLock(path)
+	if err := l.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer l.Unlock()
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestFileLockCrossProcess")
+	cmd.Env = append(os.Environ(), filelockChildEnv+"=1", "MATLOCK_FILELOCK_PATH="+path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("child process failed: %v\n%s", err, out)
+	}
+}
+
+// runFileLockChild runs as the re-exec'd child process of
+// TestFileLockCrossProcess and exits non-zero if it manages to acquire a
+// lock already held by the parent.
+func runFileLockChild() {
+	l := NewFileLock(os.Getenv("MATLOCK_FILELOCK_PATH"))
+	ok, err := l.TryLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if ok {
+		fmt.Fprintln(os.Stderr, "child unexpectedly acquired a lock already held by the parent")
+		os.Exit(1)
+	}
+}
+
+// TestWithLockSameProcessSerializes runs many concurrent WithLock calls on
+// the same path, each of which creates its own *MatFileLock. Since POSIX
+// advisory locks are keyed by (process, inode) rather than fd, a second fd
+// opened by this process would otherwise be granted the "exclusive" lock
+// immediately; fileLockInproc must serialize these in-process regardless.
+func TestWithLockSameProcessSerializes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockfile")
+
+	const n = 50
+	var (
+		wg      sync.WaitGroup
+		inside  int32
+		maxSeen int32
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithLock(path, func() error {
+				cur := atomic.AddInt32(&inside, 1)
+				for {
+					max := atomic.LoadInt32(&maxSeen)
+					if cur <= max || atomic.CompareAndSwapInt32(&maxSeen, max, cur) {
+						break
+					}
+				}
+				atomic.AddInt32(&inside, -1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithLock: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxSeen > 1 {
+		t.Fatalf("fn ran concurrently for %d callers, want at most 1", maxSeen)
+	}
+}
+
+// TestFileLockUnlockWithoutLockPanics verifies Unlock panics, rather than
+// dereferencing a nil *os.File, when called without a prior successful
+// Lock, TryLock, or LockContext.
+func TestFileLockUnlockWithoutLockPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Unlock without a prior Lock did not panic")
+		}
+	}()
+
+	l := NewFileLock(filepath.Join(t.TempDir(), "lockfile"))
+	l.Unlock()
+}
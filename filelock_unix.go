@@ -0,0 +1,48 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(f *os.File, exclusive bool) error {
+	lt := syscall.Flock_t{
+		Type:   syscall.F_WRLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+	if !exclusive {
+		lt.Type = syscall.F_RDLCK
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lt)
+}
+
+func tryLockFile(f *os.File) (bool, error) {
+	lt := syscall.Flock_t{
+		Type:   syscall.F_WRLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+	err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lt)
+	if err == nil {
+		return true, nil
+	}
+	if err == syscall.EAGAIN || err == syscall.EACCES {
+		return false, nil
+	}
+	return false, err
+}
+
+func unlockFile(f *os.File) error {
+	lt := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lt)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ReentrantMatLock is a MatLock variant that lets the goroutine currently
+// holding the lock re-acquire it, incrementing a recursion depth instead
+// of deadlocking against itself. It exists mainly to ease porting code
+// written against thread-local-reentrant locks from other languages; new
+// code should prefer plain MatLock, which is cheaper and doesn't hide
+// accidental re-entrancy bugs.
+//
+// ReentrantMatLock is advisory: it identifies the owner by goroutine id,
+// obtained by parsing the "goroutine N [" line that runtime.Stack writes,
+// since the runtime deliberately does not expose goroutine ids through a
+// public API. That check has to run on every Lock/Unlock, including the
+// re-entrant fast path, because a different goroutine can call Lock
+// while the current owner holds it at depth > 1 and must still be made
+// to block rather than wrongly treated as a recursive re-entry. Packages
+// like github.com/petermattis/goid read the id straight off the g
+// struct via a per-arch assembly stub, which is cheaper, but that route
+// means carrying and maintaining unsafe, Go-version-pinned assembly for
+// every GOARCH we'd want to support; we'd rather pay the runtime.Stack
+// cost on this path than take on that maintenance burden. Unlock panics
+// if called by a goroutine that isn't the current owner.
+type ReentrantMatLock struct {
+	lock  *MatLock
+	owner int64
+	depth int32
+}
+
+func NewReentrantMatLock() *ReentrantMatLock {
+	return &ReentrantMatLock{lock: NewQutex()}
+}
+
+// Lock acquires the lock. If the calling goroutine already holds it, Lock
+// increments the recursion depth instead of blocking.
+func (r *ReentrantMatLock) Lock() {
+	gid := goroutineID()
+	if atomic.LoadInt64(&r.owner) == gid {
+		r.depth++
+		return
+	}
+	r.lock.Lock()
+	atomic.StoreInt64(&r.owner, gid)
+	r.depth = 1
+}
+
+// Unlock decrements the recursion depth, releasing the underlying lock
+// only once it reaches zero. It panics if the calling goroutine does not
+// own the lock.
+func (r *ReentrantMatLock) Unlock() {
+	gid := goroutineID()
+	if atomic.LoadInt64(&r.owner) != gid {
+		panic("ReentrantMatLock: Unlock called by a goroutine that does not own the lock")
+	}
+	r.depth--
+	if r.depth == 0 {
+		atomic.StoreInt64(&r.owner, 0)
+		r.lock.Unlock()
+	}
+}
+
+// goroutineIDBuf pools the scratch buffer runtime.Stack writes into, so
+// the identity check doesn't allocate on every call. It only avoids that
+// one allocation: goroutineID still captures and re-parses a stack trace
+// on every Lock/Unlock, including repeated re-entrant acquisitions by
+// the same goroutine, since there's no cheaper place to cache the id
+// without the assembly route described above.
+var goroutineIDBuf = sync.Pool{
+	New: func() any {
+		b := make([]byte, 64)
+		return &b
+	},
+}
+
+func goroutineID() int64 {
+	bufp := goroutineIDBuf.Get().(*[]byte)
+	buf := *bufp
+
+	n := runtime.Stack(buf, false)
+	line := buf[:n]
+
+	const prefix = "goroutine "
+	line = bytes.TrimPrefix(line, []byte(prefix))
+	end := bytes.IndexByte(line, ' ')
+	if end < 0 {
+		goroutineIDBuf.Put(bufp)
+		panic("matlock: unexpected runtime.Stack format")
+	}
+
+	id, err := strconv.ParseInt(string(line[:end]), 10, 64)
+	goroutineIDBuf.Put(bufp)
+	if err != nil {
+		panic("matlock: cannot parse goroutine id: " + err.Error())
+	}
+	return id
+}
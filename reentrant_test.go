@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestReentrantMatLockRecursion(t *testing.T) {
+	r := NewReentrantMatLock()
+	r.Lock()
+	r.Lock()
+	r.Lock()
+	r.Unlock()
+	r.Unlock()
+	r.Unlock()
+
+	// A fully unlocked ReentrantMatLock must be lockable again.
+	r.Lock()
+	r.Unlock()
+}
+
+func TestReentrantMatLockUnlockByNonOwnerPanics(t *testing.T) {
+	r := NewReentrantMatLock()
+	r.Lock()
+	defer r.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if recover() == nil {
+				t.Error("Unlock by non-owning goroutine did not panic")
+			}
+		}()
+		r.Unlock()
+	}()
+	<-done
+}
+
+func BenchmarkMatLockLockUnlock(b *testing.B) {
+	l := NewQutex()
+	for i := 0; i < b.N; i++ {
+		l.Lock()
+		l.Unlock()
+	}
+}
+
+func BenchmarkReentrantMatLockLockUnlock(b *testing.B) {
+	r := NewReentrantMatLock()
+	for i := 0; i < b.N; i++ {
+		r.Lock()
+		r.Unlock()
+	}
+}
+
+func BenchmarkReentrantMatLockNestedLockUnlock(b *testing.B) {
+	r := NewReentrantMatLock()
+	for i := 0; i < b.N; i++ {
+		r.Lock()
+		r.Lock()
+		r.Lock()
+		r.Unlock()
+		r.Unlock()
+		r.Unlock()
+	}
+}